@@ -0,0 +1,332 @@
+// Package extract safely unpacks tar.gz archives, optionally wrapped in a
+// ZIP as GitHub Actions artifacts are, into a destination directory.
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	defaultMaxUncompressedSize = 1 << 30 // 1 GiB
+	defaultMaxEntries          = 100000
+)
+
+// Extractor unpacks archives while guarding against zip-slip/tar-slip path
+// escapes and decompression bombs.
+type Extractor struct {
+	// MaxUncompressedSize caps the total bytes written across all entries.
+	// Zero uses a sane default.
+	MaxUncompressedSize int64
+	// MaxEntries caps the number of archive entries processed. Zero uses a
+	// sane default.
+	MaxEntries int
+}
+
+// New returns an Extractor configured with default limits.
+func New() *Extractor {
+	return &Extractor{
+		MaxUncompressedSize: defaultMaxUncompressedSize,
+		MaxEntries:          defaultMaxEntries,
+	}
+}
+
+func (e *Extractor) limits() (maxSize int64, maxEntries int) {
+	maxSize = e.MaxUncompressedSize
+	if maxSize <= 0 {
+		maxSize = defaultMaxUncompressedSize
+	}
+	maxEntries = e.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultMaxEntries
+	}
+	return maxSize, maxEntries
+}
+
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// Extract detects the archive format at path (plain ZIP, ZIP-wrapped
+// tar.gz as produced by GitHub Actions, plain tar.gz, or tar.zst) and
+// unpacks it into dest.
+func (e *Extractor) Extract(path, dest string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(f, header); err != nil {
+		return fmt.Errorf("reading archive header: %w", err)
+	}
+
+	switch {
+	case bytes.Equal(header, []byte("PK\x03\x04")):
+		return e.ExtractZippedTarGz(path, dest)
+	case header[0] == 0x1f && header[1] == 0x8b:
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return e.ExtractTarGz(f, dest)
+	case bytes.Equal(header, zstdMagic):
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return e.ExtractTarZst(f, dest)
+	default:
+		return fmt.Errorf("unrecognized archive format (magic %x)", header)
+	}
+}
+
+// ExtractZippedTarGz unpacks the ZIP at zipPath. If it wraps a single
+// *.tar.gz member (GitHub Actions' artifact convention), that member is
+// streamed straight into dest without ever being written to disk.
+// Otherwise the ZIP's own entries are extracted directly.
+func (e *Extractor) ExtractZippedTarGz(zipPath, dest string) error {
+	zr, err := zip.OpenReader(zipPath)
+	if err != nil {
+		return fmt.Errorf("opening zip: %w", err)
+	}
+	defer zr.Close()
+
+	for _, f := range zr.File {
+		if !strings.HasSuffix(f.Name, ".tar.gz") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", f.Name, err)
+		}
+		defer rc.Close()
+		return e.ExtractTarGz(rc, dest)
+	}
+
+	return e.extractZipEntries(&zr.Reader, dest)
+}
+
+// ExtractTarGz streams a gzip-compressed tar archive from r into dest.
+func (e *Extractor) ExtractTarGz(r io.Reader, dest string) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("opening gzip stream: %w", err)
+	}
+	defer gz.Close()
+
+	return e.extractTar(gz, dest)
+}
+
+// ExtractTarZst streams a zstd-compressed tar archive from r into dest.
+func (e *Extractor) ExtractTarZst(r io.Reader, dest string) error {
+	zr, err := zstd.NewReader(r)
+	if err != nil {
+		return fmt.Errorf("opening zstd stream: %w", err)
+	}
+	defer zr.Close()
+
+	return e.extractTar(zr, dest)
+}
+
+// extractZipEntries extracts a plain ZIP's entries directly into dest,
+// applying the same path-escape and size/entry-count guards as tar
+// extraction.
+func (e *Extractor) extractZipEntries(zr *zip.Reader, dest string) error {
+	maxSize, maxEntries := e.limits()
+
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+
+	if len(zr.File) > maxEntries {
+		return fmt.Errorf("archive exceeds max entry count (%d)", maxEntries)
+	}
+
+	var written int64
+	for _, f := range zr.File {
+		target, err := safeJoin(absDest, f.Name)
+		if err != nil {
+			return err
+		}
+
+		if f.FileInfo().IsDir() {
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+
+		// f.UncompressedSize64 comes straight from the zip's central
+		// directory and isn't trustworthy: a crafted entry can understate it
+		// while its deflate stream still inflates to far more. Cap the bytes
+		// actually written instead of trusting the header.
+		remaining := maxSize - written
+		if remaining <= 0 {
+			return fmt.Errorf("archive exceeds max uncompressed size (%d bytes)", maxSize)
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("opening %s: %w", f.Name, err)
+		}
+		n, err := writeRegularFile(target, rc, f.Mode(), remaining)
+		rc.Close()
+		written += n
+		if err != nil {
+			return err
+		}
+		os.Chtimes(target, f.Modified, f.Modified) // best-effort
+	}
+
+	return nil
+}
+
+func (e *Extractor) extractTar(r io.Reader, dest string) error {
+	maxSize, maxEntries := e.limits()
+
+	absDest, err := filepath.Abs(dest)
+	if err != nil {
+		return err
+	}
+
+	tr := tar.NewReader(r)
+	var entries int
+	var written int64
+
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading tar entry: %w", err)
+		}
+
+		entries++
+		if entries > maxEntries {
+			return fmt.Errorf("archive exceeds max entry count (%d)", maxEntries)
+		}
+
+		target, err := safeJoin(absDest, hdr.Name)
+		if err != nil {
+			return err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+				return err
+			}
+			remaining := maxSize - written
+			if remaining <= 0 {
+				return fmt.Errorf("archive exceeds max uncompressed size (%d bytes)", maxSize)
+			}
+			n, err := writeRegularFile(target, tr, os.FileMode(hdr.Mode), remaining)
+			written += n
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := safeSymlink(absDest, target, hdr.Linkname); err != nil {
+				return err
+			}
+			continue // symlinks don't carry a reliable mtime to restore
+		case tar.TypeLink:
+			linkTarget, err := safeJoin(absDest, hdr.Linkname)
+			if err != nil {
+				return err
+			}
+			os.Remove(target)
+			if err := os.Link(linkTarget, target); err != nil {
+				return err
+			}
+		default:
+			// skip device nodes, fifos, and other unsupported types
+			continue
+		}
+
+		if !hdr.ModTime.IsZero() {
+			os.Chtimes(target, hdr.ModTime, hdr.ModTime) // best-effort
+		}
+	}
+}
+
+// safeJoin resolves name against base, rejecting absolute paths and any
+// result that escapes base (zip-slip/tar-slip).
+func safeJoin(base, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("entry has absolute path: %s", name)
+	}
+	joined := filepath.Join(base, name)
+	if joined != base && !strings.HasPrefix(joined, base+string(os.PathSeparator)) {
+		return "", fmt.Errorf("entry escapes destination: %s", name)
+	}
+	return joined, nil
+}
+
+// safeSymlink creates a symlink at target, rejecting link targets that
+// would resolve outside base.
+func safeSymlink(base, target, linkname string) error {
+	var resolved string
+	if filepath.IsAbs(linkname) {
+		resolved = filepath.Clean(linkname)
+	} else {
+		resolved = filepath.Clean(filepath.Join(filepath.Dir(target), linkname))
+	}
+	if resolved != base && !strings.HasPrefix(resolved, base+string(os.PathSeparator)) {
+		return fmt.Errorf("symlink target escapes destination: %s", linkname)
+	}
+	os.Remove(target)
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	return os.Symlink(linkname, target)
+}
+
+// writeRegularFile copies r into target, writing at most maxBytes regardless
+// of what an archive entry's header claims about its size: a zip entry's
+// declared UncompressedSize64 comes from the (attacker-controlled) central
+// directory and can understate how much its deflate stream actually
+// inflates to. If r still has data once maxBytes have been written, that's
+// treated as exceeding the archive's size budget rather than silently
+// truncated. Returns the number of bytes actually written.
+func writeRegularFile(target string, r io.Reader, mode os.FileMode, maxBytes int64) (int64, error) {
+	if mode == 0 {
+		mode = 0644
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return 0, err
+	}
+	defer out.Close()
+
+	n, err := io.CopyN(out, r, maxBytes)
+	if err != nil {
+		if err == io.EOF {
+			return n, nil
+		}
+		return n, err
+	}
+
+	var probe [1]byte
+	if m, _ := r.Read(probe[:]); m > 0 {
+		return n, fmt.Errorf("entry exceeds remaining size budget (%d bytes)", maxBytes)
+	}
+	return n, nil
+}
@@ -0,0 +1,154 @@
+package extract
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSafeJoin(t *testing.T) {
+	base := filepath.FromSlash("/dest")
+
+	tests := []struct {
+		name    string
+		entry   string
+		wantErr bool
+	}{
+		{name: "plain file", entry: "foo.txt"},
+		{name: "nested file", entry: "a/b/c.txt"},
+		{name: "dot entry", entry: "."},
+		{name: "absolute path rejected", entry: "/etc/passwd", wantErr: true},
+		{name: "parent traversal rejected", entry: "../outside.txt", wantErr: true},
+		{name: "nested parent traversal rejected", entry: "a/../../outside.txt", wantErr: true},
+		{name: "sibling-prefix escape rejected", entry: "../dest-evil/foo", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := safeJoin(base, tt.entry)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("safeJoin(%q) = %q, want error", tt.entry, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("safeJoin(%q) returned unexpected error: %v", tt.entry, err)
+			}
+			if got != base && filepath.Dir(got) == "" {
+				t.Fatalf("safeJoin(%q) = %q, want path under %q", tt.entry, got, base)
+			}
+		})
+	}
+}
+
+func TestSafeSymlink(t *testing.T) {
+	base := t.TempDir()
+
+	tests := []struct {
+		name     string
+		linkname string
+		wantErr  bool
+	}{
+		{name: "relative link within base", linkname: "sibling.txt"},
+		{name: "relative link into subdir", linkname: "sub/sibling.txt"},
+		{name: "absolute link outside base rejected", linkname: "/etc/passwd", wantErr: true},
+		{name: "relative traversal outside base rejected", linkname: "../../outside.txt", wantErr: true},
+	}
+
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(base, "link", filepath.Base(t.Name())+"-"+string(rune('a'+i)))
+			err := safeSymlink(base, target, tt.linkname)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("safeSymlink(linkname=%q) = nil error, want error", tt.linkname)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("safeSymlink(linkname=%q) returned unexpected error: %v", tt.linkname, err)
+			}
+		})
+	}
+}
+
+// TestWriteRegularFileCapsActualBytes covers the case a zip entry's declared
+// UncompressedSize64 understates what its stream actually produces:
+// writeRegularFile must cap on bytes actually copied, not trust that field,
+// so the caller's maxBytes budget mirrors a real archive-wide size guard
+// even when the entry lies about its own size.
+func TestWriteRegularFileCapsActualBytes(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     string
+		maxBytes int64
+		wantErr  bool
+	}{
+		{name: "under budget", data: "hello", maxBytes: 100},
+		{name: "exactly at budget", data: "hello", maxBytes: 5},
+		{name: "lying entry exceeds budget", data: strings.Repeat("x", 1000), maxBytes: 10, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := filepath.Join(t.TempDir(), "out")
+			n, err := writeRegularFile(target, bytes.NewReader([]byte(tt.data)), 0644, tt.maxBytes)
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("writeRegularFile() = (%d, nil), want error", n)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("writeRegularFile() returned unexpected error: %v", err)
+			}
+			if n != int64(len(tt.data)) {
+				t.Fatalf("writeRegularFile() wrote %d bytes, want %d", n, len(tt.data))
+			}
+
+			written, err := os.ReadFile(target)
+			if err != nil {
+				t.Fatalf("reading output file: %v", err)
+			}
+			if string(written) != tt.data {
+				t.Fatalf("output file contains %q, want %q", written, tt.data)
+			}
+		})
+	}
+}
+
+// TestWriteRegularFileNeverExceedsBudgetOnDisk confirms a stream far beyond
+// maxBytes never lands more than maxBytes of data on disk before the error
+// is returned, i.e. the cap is enforced during the copy itself rather than
+// only checked afterwards.
+func TestWriteRegularFileNeverExceedsBudgetOnDisk(t *testing.T) {
+	target := filepath.Join(t.TempDir(), "out")
+	const maxBytes = 1024
+
+	_, err := writeRegularFile(target, io.LimitReader(zeroReader{}, 1<<20), 0644, maxBytes)
+	if err == nil {
+		t.Fatal("writeRegularFile() = nil error, want error for oversized stream")
+	}
+
+	info, err := os.Stat(target)
+	if err != nil {
+		t.Fatalf("stat output file: %v", err)
+	}
+	if info.Size() > maxBytes {
+		t.Fatalf("output file is %d bytes, want at most %d", info.Size(), maxBytes)
+	}
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 0
+	}
+	return len(p), nil
+}
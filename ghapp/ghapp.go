@@ -0,0 +1,171 @@
+// Package ghapp mints short-lived GitHub App installation access tokens,
+// so artifact downloads don't depend on a long-lived personal access token
+// travelling inside every webhook payload.
+package ghapp
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const installationTokenURL = "https://api.github.com/app/installations/%d/access_tokens"
+
+// Config identifies a GitHub App installation and the private key used to
+// authenticate as it.
+type Config struct {
+	AppID          int64  `json:"app_id"`
+	InstallationID int64  `json:"installation_id"`
+	PrivateKeyPath string `json:"private_key_path"`
+}
+
+// TokenSource mints and caches installation access tokens for a single
+// GitHub App installation, refreshing them shortly before they expire.
+type TokenSource struct {
+	cfg Config
+	key *rsa.PrivateKey
+
+	mu        sync.Mutex
+	token     string
+	expiresAt time.Time
+}
+
+// NewTokenSource loads the App's private key from disk and returns a
+// TokenSource ready to mint installation tokens on demand.
+func NewTokenSource(cfg Config) (*TokenSource, error) {
+	pemBytes, err := os.ReadFile(cfg.PrivateKeyPath)
+	if err != nil {
+		return nil, fmt.Errorf("reading GitHub App private key: %w", err)
+	}
+	block, _ := pem.Decode(pemBytes)
+	if block == nil {
+		return nil, errors.New("invalid PEM private key")
+	}
+	key, err := parsePrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing GitHub App private key: %w", err)
+	}
+	return &TokenSource{cfg: cfg, key: key}, nil
+}
+
+func parsePrivateKey(der []byte) (*rsa.PrivateKey, error) {
+	if key, err := x509.ParsePKCS1PrivateKey(der); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("private key is not RSA")
+	}
+	return rsaKey, nil
+}
+
+// Token returns a cached installation token, minting a fresh one if none is
+// cached or the cached one is near expiry.
+func (t *TokenSource) Token() (string, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != "" && time.Now().Before(t.expiresAt.Add(-1*time.Minute)) {
+		return t.token, nil
+	}
+
+	jwt, err := t.signAppJWT()
+	if err != nil {
+		return "", err
+	}
+
+	token, expiresAt, err := requestInstallationToken(t.cfg.InstallationID, jwt)
+	if err != nil {
+		return "", err
+	}
+
+	t.token = token
+	t.expiresAt = expiresAt
+	return t.token, nil
+}
+
+// signAppJWT produces the short-lived RS256 JWT GitHub requires to
+// authenticate as the App itself (as opposed to one of its installations).
+func (t *TokenSource) signAppJWT() (string, error) {
+	now := time.Now()
+	header := map[string]string{"alg": "RS256", "typ": "JWT"}
+	claims := map[string]interface{}{
+		"iat": now.Add(-30 * time.Second).Unix(),
+		"exp": now.Add(9 * time.Minute).Unix(),
+		"iss": fmt.Sprintf("%d", t.cfg.AppID),
+	}
+
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." +
+		base64.RawURLEncoding.EncodeToString(claimsJSON)
+
+	hashed := sha256.Sum256([]byte(signingInput))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, t.key, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", fmt.Errorf("signing app JWT: %w", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// requestInstallationToken exchanges an App JWT for an installation access
+// token via the GitHub API.
+func requestInstallationToken(installationID int64, jwt string) (string, time.Time, error) {
+	url := fmt.Sprintf(installationTokenURL, installationID)
+
+	req, err := http.NewRequest("POST", url, nil)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("creating request failed: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+jwt)
+	req.Header.Set("Accept", "application/vnd.github+json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("reading response: %w", err)
+	}
+	if resp.StatusCode != http.StatusCreated {
+		return "", time.Time{}, fmt.Errorf("minting installation token failed: %s\n%s", resp.Status, string(body))
+	}
+
+	var parsed struct {
+		Token     string    `json:"token"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&parsed); err != nil {
+		return "", time.Time{}, fmt.Errorf("decoding response: %w", err)
+	}
+
+	return parsed.Token, parsed.ExpiresAt, nil
+}
@@ -0,0 +1,110 @@
+// Package hooks runs the optional commands or HTTP checks a project can
+// configure around its release lifecycle (pre_extract, post_extract,
+// health_check, post_activate), so migrations, cache warming, or service
+// restarts don't need to be baked into the deployer itself.
+package hooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+const defaultTimeout = 30 * time.Second
+
+// Hook is either a shell command (run via "sh -c") or an HTTP GET expected
+// to return a 2xx status. Exactly one of Command/URL should be set.
+type Hook struct {
+	Command        string `json:"command,omitempty"`
+	URL            string `json:"url,omitempty"`
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"`
+}
+
+// Config is a project's set of lifecycle hooks. A nil field runs nothing.
+type Config struct {
+	PreExtract   *Hook `json:"pre_extract,omitempty"`
+	PostExtract  *Hook `json:"post_extract,omitempty"`
+	HealthCheck  *Hook `json:"health_check,omitempty"`
+	PostActivate *Hook `json:"post_activate,omitempty"`
+}
+
+// Env is exposed to command hooks as environment variables (RELEASE_DIR,
+// PREVIOUS_RELEASE, PROJECT, AREA) and sets the command's working directory
+// to ReleaseDir.
+type Env struct {
+	ReleaseDir      string
+	PreviousRelease string
+	Project         string
+	Area            string
+}
+
+// Run executes h, if set, with its configured (or default) timeout. A nil
+// Hook is a no-op.
+func Run(h *Hook, env Env) error {
+	if h == nil {
+		return nil
+	}
+
+	timeout := defaultTimeout
+	if h.TimeoutSeconds > 0 {
+		timeout = time.Duration(h.TimeoutSeconds) * time.Second
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	switch {
+	case h.Command != "":
+		return runCommand(ctx, h.Command, env)
+	case h.URL != "":
+		return runHTTPCheck(ctx, h.URL)
+	default:
+		return errors.New("hook has neither command nor url set")
+	}
+}
+
+func runCommand(ctx context.Context, command string, env Env) error {
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = env.ReleaseDir
+	cmd.Env = append(os.Environ(),
+		"RELEASE_DIR="+env.ReleaseDir,
+		"PREVIOUS_RELEASE="+env.PreviousRelease,
+		"PROJECT="+env.Project,
+		"AREA="+env.Area,
+	)
+
+	// Run the hook in its own process group so a timeout kills anything it
+	// spawned too, not just the "sh" wrapper.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%q failed: %w\n%s", command, err, output)
+	}
+	return nil
+}
+
+func runHTTPCheck(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("creating request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("request to %s failed: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return nil
+}
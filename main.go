@@ -1,10 +1,10 @@
 package main
 
 import (
-	"archive/tar"
-	"archive/zip"
-	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -13,27 +13,128 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"regexp"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/jedisct1/go-minisign"
+
+	"github.com/walker84837/vps-deploy-service/extract"
+	"github.com/walker84837/vps-deploy-service/ghapp"
+	"github.com/walker84837/vps-deploy-service/hooks"
+	"github.com/walker84837/vps-deploy-service/queue"
+	"github.com/walker84837/vps-deploy-service/source"
+)
+
+const (
+	releasesDirName     = "releases"
+	currentLinkName     = "current"
+	defaultKeepReleases = 5
 )
 
-// AreaMap defines alias -> base path
-type AreaMap map[string]string
+// AreaConfig describes a deploy area: where it lives on disk, how many past
+// releases to retain for rollback, and which artifact sources it accepts.
+type AreaConfig struct {
+	Path         string `json:"path"`
+	KeepReleases int    `json:"keep_releases"`
+	// AllowedSources restricts which source.Source names this area accepts
+	// (e.g. "github", "gitlab", "https"). Empty means all are allowed.
+	AllowedSources []string `json:"allowed_sources,omitempty"`
+	// Hooks maps a project name to its lifecycle hooks. Projects with no
+	// entry run with no hooks at all.
+	Hooks map[string]hooks.Config `json:"hooks,omitempty"`
+}
+
+// AreaMap defines alias -> area config
+type AreaMap map[string]AreaConfig
 
-// WebhookPayload represents incoming JSON
+// RollbackPayload represents an incoming /rollback request
+type RollbackPayload struct {
+	Area       string `json:"area"`
+	Project    string `json:"project"`
+	Generation string `json:"generation"`
+}
+
+// WebhookPayload represents incoming JSON. Source selects which artifact
+// source fields apply; it defaults to "github" for backward compatibility.
 type WebhookPayload struct {
-	Area        string `json:"area"`
-	Project     string `json:"project"`
+	Area    string `json:"area"`
+	Project string `json:"project"`
+	Source  string `json:"source"`
+
+	// GitHub Actions
 	Owner       string `json:"owner"`
 	Repo        string `json:"repo"`
-	ArtifactID  string `json:"artifact_id"`
-	GitHubToken string `json:"github_token"`
-	Signature   string `json:"signature"` // minisign signature
+	ArtifactID  string `json:"artifact_id"`  // also doubles as the GitLab job ID
+	GitHubToken string `json:"github_token"` // optional if a GitHub App is configured
+
+	// GitLab CI
+	GitLabBaseURL   string `json:"gitlab_base_url,omitempty"`
+	GitLabProjectID string `json:"gitlab_project_id,omitempty"`
+	GitLabToken     string `json:"gitlab_token,omitempty"`
+
+	// Generic signed HTTPS URL
+	URL string `json:"url,omitempty"`
+
+	Signature string `json:"signature"` // minisign signature
+}
+
+// GitHubProjectRoute maps a GitHub repository's completed workflow runs to
+// a deploy area/project, selecting which run artifact to deploy.
+type GitHubProjectRoute struct {
+	Owner           string `json:"owner"`
+	Repo            string `json:"repo"`
+	Area            string `json:"area"`
+	Project         string `json:"project"`
+	ArtifactPattern string `json:"artifact_pattern"` // filepath.Match pattern, e.g. "dist-*.tar.gz"
+}
+
+// GitHubWebhookConfig configures automatic deploys from GitHub
+// workflow_run events.
+type GitHubWebhookConfig struct {
+	Secret   string               `json:"secret"` // shared secret for X-Hub-Signature-256
+	Projects []GitHubProjectRoute `json:"projects"`
+}
+
+// workflowRunEvent is the subset of GitHub's workflow_run webhook payload
+// this service cares about.
+type workflowRunEvent struct {
+	Action      string `json:"action"`
+	WorkflowRun struct {
+		ID         int64  `json:"id"`
+		Conclusion string `json:"conclusion"`
+	} `json:"workflow_run"`
+	Repository struct {
+		Name  string `json:"name"`
+		Owner struct {
+			Login string `json:"login"`
+		} `json:"owner"`
+	} `json:"repository"`
 }
 
 var areas AreaMap
 
+// ghApp mints installation tokens when a GitHub App is configured, so
+// webhook callers don't need to supply a github_token. Nil if unconfigured.
+var ghApp *ghapp.TokenSource
+
+// githubWebhook configures automatic deploys from GitHub workflow_run
+// events. Nil if unconfigured, in which case /webhook/github is disabled.
+var githubWebhook *GitHubWebhookConfig
+
+// deployQueue serializes and persists deploy jobs; see the queue package.
+var deployQueue *queue.Queue
+
+// artifactSources resolves a WebhookPayload.Source (or GitHubProjectRoute's
+// implicit "github") to the source.Source that fetches it.
+var artifactSources *source.Registry
+
+// githubSource is kept separately from artifactSources so the workflow_run
+// ingestion path (which lists run artifacts before a Source.Fetch call
+// makes sense) can reuse its token resolution.
+var githubSource *source.GitHubSource
+
 func main() {
 	// Load area map from file
 	f, err := os.Open("areas.json")
@@ -45,11 +146,148 @@ func main() {
 		log.Fatal(err)
 	}
 
+	if err := loadGitHubApp("github_app.json"); err != nil {
+		log.Fatal(err)
+	}
+	if err := loadGitHubWebhookConfig("github_webhook.json"); err != nil {
+		log.Fatal(err)
+	}
+
+	githubSource = &source.GitHubSource{App: ghApp}
+	artifactSources = source.NewRegistry(githubSource, &source.GitLabSource{}, &source.HTTPSSource{})
+
+	dq, err := queue.Open("deploy_queue.db", 0, runDeployJob)
+	if err != nil {
+		log.Fatal(err)
+	}
+	deployQueue = dq
+
 	http.HandleFunc("/deploy", deployHandler)
+	http.HandleFunc("/rollback", rollbackHandler)
+	http.HandleFunc("/webhook/github", githubWebhookHandler)
+	http.HandleFunc("/jobs", jobsHandler)
+	http.HandleFunc("/jobs/", jobsHandler)
 	log.Println("Listening on :8080")
 	log.Fatal(http.ListenAndServe(":8080", nil))
 }
 
+// areaAllowsSource reports whether area's AllowedSources permits src. An
+// empty AllowedSources permits everything.
+func areaAllowsSource(area AreaConfig, src string) error {
+	if len(area.AllowedSources) == 0 {
+		return nil
+	}
+	for _, allowed := range area.AllowedSources {
+		if allowed == src {
+			return nil
+		}
+	}
+	return fmt.Errorf("area does not permit artifact source %q", src)
+}
+
+// runDeployJob is the queue.Handler that performs an actual deploy: fetch
+// the artifact from its source, verify its signature (when the job carries
+// one; automatic GitHub webhook dispatches don't, see dispatchFromRun),
+// then stage and activate the release.
+func runDeployJob(job *queue.Job) (string, error) {
+	area, dest, err := computeFinalPath(job.Area, job.Project)
+	if err != nil {
+		return "", err
+	}
+	if err := areaAllowsSource(area, job.Source); err != nil {
+		return "", err
+	}
+
+	src, err := artifactSources.Get(job.Source)
+	if err != nil {
+		return "", err
+	}
+
+	artifactFile, err := src.Fetch(source.Request{
+		Project:         job.Project,
+		Owner:           job.Owner,
+		Repo:            job.Repo,
+		ArtifactID:      job.ArtifactID,
+		GitHubToken:     job.GitHubToken,
+		GitLabBaseURL:   job.GitLabBaseURL,
+		GitLabProjectID: job.GitLabProjectID,
+		GitLabJobID:     job.ArtifactID,
+		GitLabToken:     job.GitLabToken,
+		URL:             job.URL,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to download artifact: %w", err)
+	}
+	defer os.Remove(artifactFile)
+
+	if job.Signature != "" {
+		pubKeyBytes, err := os.ReadFile("minisign.pub")
+		if err != nil {
+			return "", fmt.Errorf("missing public key: %w", err)
+		}
+		if err := verifySignature(artifactFile, job.Signature, string(pubKeyBytes)); err != nil {
+			return "", fmt.Errorf("signature verification failed: %w", err)
+		}
+	}
+
+	return stageAndActivate(area, job.Area, job.Project, dest, artifactFile, job.ArtifactID)
+}
+
+// loadGitHubWebhookConfig configures automatic deploys from GitHub
+// workflow_run events, if configPath exists. Its absence is not an error:
+// the /deploy endpoint keeps working for manual triggers.
+func loadGitHubWebhookConfig(configPath string) error {
+	f, err := os.Open(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	var cfg GitHubWebhookConfig
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return fmt.Errorf("parsing %s: %w", configPath, err)
+	}
+	if cfg.Secret == "" {
+		return fmt.Errorf("%s: secret is required", configPath)
+	}
+	githubWebhook = &cfg
+	log.Println("GitHub workflow_run webhook ingestion enabled")
+	return nil
+}
+
+// loadGitHubApp configures the global GitHub App token source from
+// configPath, if present. Its absence is not an error: deployments can
+// still authenticate with a per-request github_token.
+func loadGitHubApp(configPath string) error {
+	f, err := os.Open(configPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	var cfg ghapp.Config
+	if err := json.NewDecoder(f).Decode(&cfg); err != nil {
+		return fmt.Errorf("parsing %s: %w", configPath, err)
+	}
+
+	ts, err := ghapp.NewTokenSource(cfg)
+	if err != nil {
+		return fmt.Errorf("configuring GitHub App: %w", err)
+	}
+	ghApp = ts
+	log.Println("GitHub App authentication enabled")
+	return nil
+}
+
+// deployHandler enqueues a deploy job and returns immediately; the job
+// subsystem (see the queue package) runs it, serialized against any other
+// deploy of the same area/project.
 func deployHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
@@ -61,175 +299,506 @@ func deployHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "invalid JSON", http.StatusBadRequest)
 		return
 	}
+	if payload.Source == "" {
+		payload.Source = "github" // backward-compatible default
+	}
 
-	dest, err := computeFinalPath(payload.Area, payload.Project)
+	area, _, err := computeFinalPath(payload.Area, payload.Project)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if err := areaAllowsSource(area, payload.Source); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !validArtifactID(payload.ArtifactID) {
+		http.Error(w, "invalid artifact_id", http.StatusBadRequest)
+		return
+	}
 
-	log.Printf("Deploying project '%s' to '%s'\n", payload.Project, dest)
-
-	// Step 1: download artifact
-	artifactFile, err := downloadArtifact(payload.Owner, payload.Repo, payload.ArtifactID, payload.GitHubToken, payload.Project)
+	job, existed, err := deployQueue.Enqueue(queue.Job{
+		Area:            payload.Area,
+		Project:         payload.Project,
+		Source:          payload.Source,
+		ArtifactID:      payload.ArtifactID,
+		Signature:       payload.Signature,
+		Owner:           payload.Owner,
+		Repo:            payload.Repo,
+		GitHubToken:     payload.GitHubToken,
+		GitLabBaseURL:   payload.GitLabBaseURL,
+		GitLabProjectID: payload.GitLabProjectID,
+		GitLabToken:     payload.GitLabToken,
+		URL:             payload.URL,
+	})
 	if err != nil {
-		http.Error(w, "failed to download artifact: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "failed to enqueue deploy: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
-	defer os.Remove(artifactFile) // clean up temp file
+	if existed {
+		log.Printf("Deploy for '%s/%s' already queued as %s (idempotent replay)\n", payload.Area, payload.Project, job.ID)
+	} else {
+		log.Printf("Queued deploy for '%s/%s' as %s\n", payload.Area, payload.Project, job.ID)
+	}
 
-	// Step 2: verify signature
-	pubKeyBytes, err := os.ReadFile("minisign.pub")
-	if err != nil {
-		http.Error(w, "missing public key: "+err.Error(), http.StatusInternalServerError)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]string{"job_id": job.ID})
+}
+
+// jobsHandler serves GET /jobs/{id} for a single job's status, and
+// GET /jobs?project=... for history, optionally scoped to a project.
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "only GET allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	if err := verifySignature(artifactFile, payload.Signature, string(pubKeyBytes)); err != nil {
-		http.Error(w, "signature verification failed: "+err.Error(), http.StatusForbidden)
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if id := strings.TrimPrefix(r.URL.Path, "/jobs/"); id != "" && r.URL.Path != "/jobs" {
+		job, ok := deployQueue.Get(id)
+		if !ok {
+			http.Error(w, "job not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(job)
+		return
+	}
+
+	json.NewEncoder(w).Encode(deployQueue.List(r.URL.Query().Get("project")))
+}
+
+// stageAndActivate extracts artifactFile into a fresh, timestamped release
+// directory under dest (rather than wiping the live project folder in
+// place), atomically swings `current` to it, and prunes old releases
+// beyond the area's configured retention. Returns the new generation name.
+func stageAndActivate(area AreaConfig, areaAlias, project, dest, artifactFile, artifactID string) (string, error) {
+	generation := newGenerationName(artifactID)
+	releaseDir := filepath.Join(dest, releasesDirName, generation)
+	if err := os.MkdirAll(releaseDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create release folder: %w", err)
+	}
+
+	previousRelease, _ := os.Readlink(filepath.Join(dest, currentLinkName))
+	hookEnv := hooks.Env{
+		ReleaseDir:      releaseDir,
+		PreviousRelease: previousRelease,
+		Project:         project,
+		Area:            areaAlias,
+	}
+	projectHooks := area.Hooks[project]
+
+	if err := hooks.Run(projectHooks.PreExtract, hookEnv); err != nil {
+		os.RemoveAll(releaseDir)
+		return "", fmt.Errorf("pre_extract hook failed: %w", err)
+	}
+
+	if err := extract.New().Extract(artifactFile, releaseDir); err != nil {
+		os.RemoveAll(releaseDir)
+		return "", fmt.Errorf("failed to extract artifact: %w", err)
+	}
+
+	if err := hooks.Run(projectHooks.PostExtract, hookEnv); err != nil {
+		os.RemoveAll(releaseDir)
+		return "", fmt.Errorf("post_extract hook failed: %w", err)
+	}
+
+	// The health check gates cut-over: if it fails, the previous release
+	// stays live and the staged one (now the newest under releases/) is left
+	// on disk for inspection, subject to the same pruneReleases sweep below
+	// as any other release, rather than activated.
+	if err := hooks.Run(projectHooks.HealthCheck, hookEnv); err != nil {
+		if pruneErr := pruneReleases(dest, area.KeepReleases); pruneErr != nil {
+			log.Printf("warning: failed to prune old releases for '%s': %v\n", dest, pruneErr)
+		}
+		return "", fmt.Errorf("health check failed, keeping previous release live: %w", err)
+	}
+
+	if err := activateRelease(dest, releaseDir); err != nil {
+		return "", fmt.Errorf("failed to activate release: %w", err)
+	}
+
+	if err := hooks.Run(projectHooks.PostActivate, hookEnv); err != nil {
+		log.Printf("warning: post_activate hook failed for '%s': %v\n", dest, err)
+	}
+
+	if err := pruneReleases(dest, area.KeepReleases); err != nil {
+		log.Printf("warning: failed to prune old releases for '%s': %v\n", dest, err)
+	}
+
+	return generation, nil
+}
+
+// isDirectChild reports whether path is exactly one path component below
+// parent. payload.Generation lacking "/" and "\\" still lets a value like
+// ".." through, which filepath.Join(parent, "..") collapses back to parent
+// (or higher) instead of a real release; requiring path's own parent to be
+// exactly parent rules that out, since a genuine release is always a direct
+// child of releasesDir.
+func isDirectChild(path, parent string) bool {
+	return filepath.Dir(path) == parent
+}
+
+// rollbackHandler re-points `current` at a previously deployed generation.
+func rollbackHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	// Step 3: remove old folder
-	if err := os.RemoveAll(dest); err != nil {
-		http.Error(w, "failed to remove old project folder: "+err.Error(), http.StatusInternalServerError)
+	var payload RollbackPayload
+	if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	// Step 4: recreate folder
-	if err := os.MkdirAll(dest, 0755); err != nil {
-		http.Error(w, "failed to create project folder: "+err.Error(), http.StatusInternalServerError)
+	if payload.Generation == "" || strings.ContainsAny(payload.Generation, "/\\") {
+		http.Error(w, "invalid generation", http.StatusBadRequest)
 		return
 	}
 
-	// Step 5: extract tar.gz from inside the zip
-	if err := extractTarGzFromZip(artifactFile, dest); err != nil {
-		http.Error(w, "failed to extract artifact: "+err.Error(), http.StatusInternalServerError)
+	area, dest, err := computeFinalPath(payload.Area, payload.Project)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	log.Printf("Deployment complete: %s\n", dest)
+	releasesDir := filepath.Join(dest, releasesDirName)
+	releaseDir := filepath.Join(releasesDir, payload.Generation)
+	if !isDirectChild(releaseDir, releasesDir) {
+		http.Error(w, "invalid generation", http.StatusBadRequest)
+		return
+	}
+	if info, err := os.Stat(releaseDir); err != nil || !info.IsDir() {
+		http.Error(w, "unknown generation: "+payload.Generation, http.StatusNotFound)
+		return
+	}
+
+	// Rollback swings the same `current` symlink a queued deploy for this
+	// project would, so it has to serialize against the queue the same way:
+	// otherwise a rollback can interleave with an in-flight deploy and leave
+	// `current` pointing at whichever one happened to finish last.
+	err = deployQueue.WithProjectLock(payload.Area, payload.Project, func() error {
+		previousRelease, _ := os.Readlink(filepath.Join(dest, currentLinkName))
+
+		if err := activateRelease(dest, releaseDir); err != nil {
+			return fmt.Errorf("failed to roll back: %w", err)
+		}
+
+		// A rollback is a cut-over too, so run post_activate the same as a
+		// forward deploy would (e.g. to restart a service against the
+		// now-active release).
+		if err := hooks.Run(area.Hooks[payload.Project].PostActivate, hooks.Env{
+			ReleaseDir:      releaseDir,
+			PreviousRelease: previousRelease,
+			Project:         payload.Project,
+			Area:            payload.Area,
+		}); err != nil {
+			log.Printf("warning: post_activate hook failed for '%s': %v\n", dest, err)
+		}
+		return nil
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("Rolled back '%s' to %s\n", dest, payload.Generation)
 	w.Write([]byte("success"))
 }
 
-// extractTarGzFromZip extracts the first .tar.gz file from a ZIP to destPath
-func extractTarGzFromZip(zipPath, destPath string) error {
-	r, err := zip.OpenReader(zipPath)
-	if err != nil {
-		return err
+// artifactIDPattern matches the only artifact_id values safe to fold into a
+// release directory name: validArtifactID rejects anything else before it
+// ever reaches newGenerationName/filepath.Join.
+var artifactIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// validArtifactID reports whether id is safe to use as (part of) a release
+// directory name. An empty id is valid: the https source often leaves it
+// unset and relies on URL instead. Anything else has to be a single path
+// component, since it's joined straight into a filesystem path later.
+func validArtifactID(id string) bool {
+	if id == "" {
+		return true
+	}
+	// "." and ".." match artifactIDPattern but are traversal components, not
+	// real identifiers, once joined into a path.
+	return id != "." && id != ".." && artifactIDPattern.MatchString(id)
+}
+
+// newGenerationName builds a sortable, unique release directory name from
+// the current time and an artifact identifier (e.g. a commit SHA).
+func newGenerationName(artifactID string) string {
+	ts := time.Now().UTC().Format("20060102T150405Z")
+	if artifactID == "" {
+		return ts
 	}
-	defer r.Close()
+	return ts + "-" + artifactID
+}
+
+// activateRelease atomically swings the `current` symlink at dest to point
+// at releaseDir, via a temporary symlink plus rename.
+func activateRelease(dest, releaseDir string) error {
+	currentLink := filepath.Join(dest, currentLinkName)
+	tmpLink := currentLink + ".tmp"
 
-	for _, f := range r.File {
-		if strings.HasSuffix(f.Name, ".tar.gz") {
-			rc, err := f.Open()
-			if err != nil {
-				return err
-			}
-			defer rc.Close()
+	os.Remove(tmpLink) // clean up any leftover from a previous failed attempt
+
+	if err := os.Symlink(releaseDir, tmpLink); err != nil {
+		return fmt.Errorf("creating temporary symlink: %w", err)
+	}
+	if err := os.Rename(tmpLink, currentLink); err != nil {
+		os.Remove(tmpLink)
+		return fmt.Errorf("swinging current symlink: %w", err)
+	}
+	return nil
+}
 
-			outFile, err := os.Create(destPath)
-			if err != nil {
-				return err
-			}
-			defer outFile.Close()
+// pruneReleases removes the oldest release directories under dest/releases,
+// keeping at most `keep` of the newest ones. keep <= 0 disables pruning.
+func pruneReleases(dest string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
 
-			if _, err := io.Copy(outFile, rc); err != nil {
-				return err
-			}
+	releasesDir := filepath.Join(dest, releasesDirName)
+	entries, err := os.ReadDir(releasesDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
 
-			return nil // successfully extracted
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			names = append(names, e.Name())
 		}
 	}
+	if len(names) <= keep {
+		return nil
+	}
 
-	return errors.New(".tar.gz not found in ZIP")
+	sort.Strings(names) // generation names are zero-padded timestamps, so lexical sort is chronological
+	current, _ := os.Readlink(filepath.Join(dest, currentLinkName))
+
+	for _, name := range names[:len(names)-keep] {
+		dir := filepath.Join(releasesDir, name)
+		if dir == current {
+			continue // never prune the active release
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-// computeFinalPath combines area alias and project name safely
-func computeFinalPath(area, project string) (string, error) {
-	base, ok := areas[area]
+// computeFinalPath combines area alias and project name safely, returning
+// the resolved area config alongside the absolute project destination.
+func computeFinalPath(area, project string) (AreaConfig, string, error) {
+	cfg, ok := areas[area]
 	if !ok {
-		return "", errors.New("unknown area alias: " + area)
+		return AreaConfig{}, "", errors.New("unknown area alias: " + area)
 	}
-	dest := filepath.Join(base, project)
+	dest := filepath.Join(cfg.Path, project)
 	// prevent escaping the base folder
 	absDest, err := filepath.Abs(dest)
 	if err != nil {
-		return "", err
+		return AreaConfig{}, "", err
 	}
-	absBase, _ := filepath.Abs(base)
+	absBase, _ := filepath.Abs(cfg.Path)
 	if !strings.HasPrefix(absDest, absBase) {
-		return "", errors.New("project path escapes area base")
+		return AreaConfig{}, "", errors.New("project path escapes area base")
 	}
-	return absDest, nil
+	if cfg.KeepReleases <= 0 {
+		cfg.KeepReleases = defaultKeepReleases
+	}
+	return cfg, absDest, nil
 }
 
-// downloadArtifact downloads a GitHub workflow artifact using a token
-// downloadArtifact downloads a GitHub workflow artifact using a token
-func downloadArtifact(owner, repo, artifactID, token, project string) (string, error) {
-	if token == "" {
-		return "", errors.New("missing GitHub token")
+// githubWebhookHandler accepts signed GitHub `workflow_run` events and
+// dispatches deploys automatically, without requiring the caller to know an
+// artifact_id or provide a github_token up front.
+func githubWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "only POST allowed", http.StatusMethodNotAllowed)
+		return
 	}
-	if owner == "" || repo == "" {
-		return "", errors.New("missing owner or repo")
+	if githubWebhook == nil {
+		http.Error(w, "github webhook ingestion not configured", http.StatusServiceUnavailable)
+		return
 	}
 
-	// Use archive_format=zip
-	url := fmt.Sprintf(
-		"https://api.github.com/repos/%s/%s/actions/artifacts/%s/zip",
-		owner, repo, artifactID,
-	)
-
-	req, err := http.NewRequest("GET", url, nil)
+	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		return "", fmt.Errorf("creating request failed: %w", err)
+		http.Error(w, "failed to read body", http.StatusBadRequest)
+		return
 	}
-	req.Header.Set("Authorization", "Bearer "+token)
-	req.Header.Set("Accept", "application/vnd.github+json")
 
-	client := &http.Client{
-		CheckRedirect: func(req *http.Request, via []*http.Request) error {
-			// Allow following redirects (the 302)
-			return nil
-		},
+	if err := verifyHubSignature(body, r.Header.Get("X-Hub-Signature-256"), githubWebhook.Secret); err != nil {
+		http.Error(w, "signature verification failed: "+err.Error(), http.StatusForbidden)
+		return
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("http request failed: %w", err)
+
+	if r.Header.Get("X-GitHub-Event") != "workflow_run" {
+		w.Write([]byte("ignored: not a workflow_run event"))
+		return
+	}
+
+	var event workflowRunEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+
+	if event.Action != "completed" || event.WorkflowRun.Conclusion != "success" {
+		w.Write([]byte("ignored: run did not complete successfully"))
+		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusFound {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("failed to download artifact: %s\n%s", resp.Status, string(bodyBytes))
+	routes := matchingRoutes(event.Repository.Owner.Login, event.Repository.Name)
+	if len(routes) == 0 {
+		w.Write([]byte("ignored: no matching project route"))
+		return
 	}
 
-	// If 302 Found, the redirect location is the actual zip URL
-	if resp.StatusCode == http.StatusFound {
-		redirectURL := resp.Header.Get("Location")
-		if redirectURL == "" {
-			return "", errors.New("artifact redirect location missing")
+	for _, route := range routes {
+		if err := dispatchFromRun(route, event.Repository.Owner.Login, event.Repository.Name, event.WorkflowRun.ID); err != nil {
+			log.Printf("github webhook deploy failed for area=%s project=%s: %v\n", route.Area, route.Project, err)
 		}
-		// Download from redirect URL
-		resp, err = http.Get(redirectURL)
-		if err != nil {
-			return "", fmt.Errorf("failed to download redirected artifact: %w", err)
+	}
+
+	w.Write([]byte("accepted"))
+}
+
+// verifyHubSignature checks header against the `sha256=<hex hmac>` GitHub
+// sends in X-Hub-Signature-256, using a constant-time comparison.
+func verifyHubSignature(body []byte, header, secret string) error {
+	const prefix = "sha256="
+	if !strings.HasPrefix(header, prefix) {
+		return errors.New("missing or malformed X-Hub-Signature-256 header")
+	}
+
+	expected, err := hex.DecodeString(strings.TrimPrefix(header, prefix))
+	if err != nil {
+		return errors.New("malformed signature hex")
+	}
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal(mac.Sum(nil), expected) {
+		return errors.New("signature mismatch")
+	}
+	return nil
+}
+
+// matchingRoutes returns the configured project routes for owner/repo.
+func matchingRoutes(owner, repo string) []GitHubProjectRoute {
+	var matches []GitHubProjectRoute
+	for _, p := range githubWebhook.Projects {
+		if strings.EqualFold(p.Owner, owner) && strings.EqualFold(p.Repo, repo) {
+			matches = append(matches, p)
 		}
-		defer resp.Body.Close()
 	}
+	return matches
+}
+
+// dispatchFromRun downloads the artifact matching route's pattern from a
+// completed workflow run and deploys it.
+//
+// Unlike /deploy, this path doesn't require a minisign signature: trust
+// comes from the HMAC-verified webhook event plus pulling the artifact
+// ourselves from GitHub's API with our own credentials, rather than from an
+// unauthenticated caller handing us a signed blob.
+func dispatchFromRun(route GitHubProjectRoute, owner, repo string, runID int64) error {
+	token, err := githubSource.Token("")
+	if err != nil {
+		return err
+	}
+
+	artifacts, err := listRunArtifacts(owner, repo, runID, token)
+	if err != nil {
+		return fmt.Errorf("listing run artifacts: %w", err)
+	}
+
+	artifact, err := selectArtifact(artifacts, route.ArtifactPattern)
+	if err != nil {
+		return err
+	}
+
+	artifactID := fmt.Sprintf("%d", artifact.ID)
+	job, existed, err := deployQueue.Enqueue(queue.Job{
+		Area:        route.Area,
+		Project:     route.Project,
+		Source:      "github",
+		ArtifactID:  artifactID,
+		Owner:       owner,
+		Repo:        repo,
+		GitHubToken: token,
+	})
+	if err != nil {
+		return fmt.Errorf("enqueuing deploy: %w", err)
+	}
+	if existed {
+		log.Printf("Deploy for run %d already queued as %s (idempotent replay)\n", runID, job.ID)
+	} else {
+		log.Printf("Queued deploy for run %d as %s\n", runID, job.ID)
+	}
+	return nil
+}
+
+// ghArtifact is the subset of a GitHub Actions artifact this service needs.
+type ghArtifact struct {
+	ID   int64  `json:"id"`
+	Name string `json:"name"`
+}
+
+// listRunArtifacts lists the artifacts produced by a workflow run.
+func listRunArtifacts(owner, repo string, runID int64, token string) ([]ghArtifact, error) {
+	url := fmt.Sprintf("https://api.github.com/repos/%s/%s/actions/runs/%d/artifacts", owner, repo, runID)
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("creating request failed: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "application/vnd.github+json")
 
-	// Create a temp file path using os.TempDir
-	dest := filepath.Join(os.TempDir(), fmt.Sprintf("%s.zip", project))
-	outFile, err := os.Create(dest)
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to create file: %w", err)
+		return nil, fmt.Errorf("http request failed: %w", err)
 	}
-	defer outFile.Close()
+	defer resp.Body.Close()
 
-	if _, err := io.Copy(outFile, resp.Body); err != nil {
-		return "", fmt.Errorf("failed to write file: %w", err)
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("listing artifacts failed: %s\n%s", resp.Status, string(body))
 	}
 
-	return dest, nil
+	var parsed struct {
+		Artifacts []ghArtifact `json:"artifacts"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, fmt.Errorf("decoding artifacts response: %w", err)
+	}
+	return parsed.Artifacts, nil
+}
+
+// selectArtifact returns the first artifact whose name matches pattern
+// (a filepath.Match shell pattern).
+func selectArtifact(artifacts []ghArtifact, pattern string) (ghArtifact, error) {
+	for _, a := range artifacts {
+		matched, err := filepath.Match(pattern, a.Name)
+		if err != nil {
+			return ghArtifact{}, fmt.Errorf("invalid artifact pattern %q: %w", pattern, err)
+		}
+		if matched {
+			return a, nil
+		}
+	}
+	return ghArtifact{}, fmt.Errorf("no artifact matching pattern %q", pattern)
 }
 
 // verifySignature reads the file, decodes the base64 signature, and verifies it
@@ -269,53 +838,3 @@ func verifySignature(filePath, base64Sig, pubKey string) error {
 
 	return nil
 }
-
-// extractTarGz extracts a tar.gz to dest
-func extractTarGz(file, dest string) error {
-	f, err := os.Open(file)
-	if err != nil {
-		return err
-	}
-	defer f.Close()
-
-	gz, err := gzip.NewReader(f)
-	if err != nil {
-		return err
-	}
-	defer gz.Close()
-
-	tr := tar.NewReader(gz)
-	for {
-		hdr, err := tr.Next()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return err
-		}
-
-		target := filepath.Join(dest, hdr.Name)
-		switch hdr.Typeflag {
-		case tar.TypeDir:
-			if err := os.MkdirAll(target, 0755); err != nil {
-				return err
-			}
-		case tar.TypeReg:
-			if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
-				return err
-			}
-			outFile, err := os.Create(target)
-			if err != nil {
-				return err
-			}
-			if _, err := io.Copy(outFile, tr); err != nil {
-				outFile.Close()
-				return err
-			}
-			outFile.Close()
-		default:
-			// skip other types
-		}
-	}
-	return nil
-}
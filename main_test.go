@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"path/filepath"
+	"testing"
+)
+
+func sign(t *testing.T, body []byte, secret string) string {
+	t.Helper()
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyHubSignature(t *testing.T) {
+	const secret = "s3kret"
+	body := []byte(`{"action":"completed"}`)
+	validHeader := sign(t, body, secret)
+
+	tests := []struct {
+		name    string
+		body    []byte
+		header  string
+		secret  string
+		wantErr bool
+	}{
+		{name: "valid signature", body: body, header: validHeader, secret: secret},
+		{
+			name:    "tampered body",
+			body:    append([]byte(nil), append(body, 'x')...),
+			header:  validHeader,
+			secret:  secret,
+			wantErr: true,
+		},
+		{name: "wrong secret", body: body, header: validHeader, secret: "other", wantErr: true},
+		{name: "missing prefix", body: body, header: hex.EncodeToString([]byte("abc")), secret: secret, wantErr: true},
+		{name: "malformed hex", body: body, header: "sha256=not-hex", secret: secret, wantErr: true},
+		{name: "empty header", body: body, header: "", secret: secret, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyHubSignature(tt.body, tt.header, tt.secret)
+			if tt.wantErr && err == nil {
+				t.Fatalf("verifyHubSignature() = nil, want error")
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("verifyHubSignature() = %v, want nil", err)
+			}
+		})
+	}
+}
+
+func TestValidArtifactID(t *testing.T) {
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{id: "", want: true},
+		{id: "abc123", want: true},
+		{id: "deadbeef.1_2-3", want: true},
+		{id: "../../../../tmp/evil", want: false},
+		{id: "..", want: false},
+		{id: "/etc/passwd", want: false},
+		{id: "a/b", want: false},
+		{id: `a\b`, want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.id, func(t *testing.T) {
+			if got := validArtifactID(tt.id); got != tt.want {
+				t.Errorf("validArtifactID(%q) = %v, want %v", tt.id, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsDirectChild(t *testing.T) {
+	releasesDir := filepath.FromSlash("/srv/app/releases")
+
+	tests := []struct {
+		name string
+		gen  string
+		want bool
+	}{
+		{name: "ordinary generation", gen: "20260101T000000Z-abc123", want: true},
+		{name: "parent traversal collapses to releasesDir itself", gen: "..", want: false},
+		{name: "parent traversal escapes above releasesDir", gen: "../../evil", want: false},
+		{name: "nested path", gen: "sub/evil", want: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			releaseDir := filepath.Join(releasesDir, tt.gen)
+			if got := isDirectChild(releaseDir, releasesDir); got != tt.want {
+				t.Errorf("isDirectChild(%q, %q) = %v, want %v", releaseDir, releasesDir, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,405 @@
+// Package queue serializes deploys per (area, project), persists job state
+// to bbolt so status survives a restart, and de-duplicates repeated
+// submissions of the same artifact.
+package queue
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	jobsBucket        = "jobs"
+	idempotencyBucket = "idempotency"
+
+	// idempotencyTTL bounds how long a repeated submission of the same
+	// artifact+signature returns the existing job instead of re-deploying.
+	idempotencyTTL = 10 * time.Minute
+
+	defaultWorkers = 4
+)
+
+// Status is the lifecycle state of a Job.
+type Status string
+
+const (
+	StatusQueued    Status = "queued"
+	StatusRunning   Status = "running"
+	StatusSucceeded Status = "succeeded"
+	StatusFailed    Status = "failed"
+)
+
+// Job is a single deploy request moving through the queue. Fields beyond
+// Area/Project/ArtifactID/Signature are opaque to the queue package itself:
+// it just persists and replays them to the Handler, which knows how to turn
+// them into an artifact source.Request.
+type Job struct {
+	ID         string     `json:"id"`
+	Area       string     `json:"area"`
+	Project    string     `json:"project"`
+	Source     string     `json:"source"`
+	ArtifactID string     `json:"artifact_id"`
+	Signature  string     `json:"signature"`
+	Status     Status     `json:"status"`
+	Logs       []string   `json:"logs,omitempty"`
+	Generation string     `json:"generation,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+
+	// Source-specific fetch parameters, threaded straight through to the
+	// Handler's source.Request.
+	Owner           string `json:"owner,omitempty"`
+	Repo            string `json:"repo,omitempty"`
+	GitLabBaseURL   string `json:"gitlab_base_url,omitempty"`
+	GitLabProjectID string `json:"gitlab_project_id,omitempty"`
+
+	// Secrets are only ever held in memory for the duration of the deploy;
+	// they are deliberately excluded from JSON so they never land in the
+	// bbolt store or a /jobs response. URL counts as a secret too: the
+	// https source's whole trust model is a pre-signed URL carrying its own
+	// auth token.
+	GitHubToken string `json:"-"`
+	GitLabToken string `json:"-"`
+	URL         string `json:"-"`
+
+	// NeedsSecret records whether Enqueue saw a non-empty secret above. It
+	// IS persisted (unlike the secrets themselves) so loadFromDisk can tell
+	// a job that never needed one from a job whose credential just didn't
+	// survive the restart, and refuse to silently resume the latter.
+	NeedsSecret bool `json:"needs_secret,omitempty"`
+}
+
+func (j *Job) key() string { return projectKey(j.Area, j.Project) }
+
+func projectKey(area, project string) string { return area + "/" + project }
+
+// Handler performs the actual deploy work for a job and returns the
+// resulting release generation.
+type Handler func(job *Job) (generation string, err error)
+
+// Queue enqueues deploy jobs into a worker pool that guarantees at most one
+// concurrent deploy per (area, project).
+type Queue struct {
+	db      *bolt.DB
+	handler Handler
+	jobsCh  chan *Job
+
+	jobsMu sync.RWMutex
+	jobs   map[string]*Job
+
+	projectLocksMu sync.Mutex
+	projectLocks   map[string]*sync.Mutex
+}
+
+// Open opens (or creates) the bbolt store at dbPath and starts a worker
+// pool that calls handler for each dequeued job. Jobs left `queued` by a
+// previous crash are resumed.
+func Open(dbPath string, workers int, handler Handler) (*Queue, error) {
+	db, err := bolt.Open(dbPath, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("opening job store: %w", err)
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		if _, err := tx.CreateBucketIfNotExists([]byte(jobsBucket)); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucketIfNotExists([]byte(idempotencyBucket))
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("initializing job store: %w", err)
+	}
+
+	if workers <= 0 {
+		workers = defaultWorkers
+	}
+
+	q := &Queue{
+		db:           db,
+		handler:      handler,
+		jobsCh:       make(chan *Job, 256),
+		jobs:         make(map[string]*Job),
+		projectLocks: make(map[string]*sync.Mutex),
+	}
+
+	resumable, err := q.loadFromDisk()
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	for i := 0; i < workers; i++ {
+		go q.worker()
+	}
+
+	for _, job := range resumable {
+		q.jobsCh <- job
+	}
+
+	return q, nil
+}
+
+// Close stops accepting new jobs and closes the underlying store. In-flight
+// jobs are allowed to finish.
+func (q *Queue) Close() error {
+	close(q.jobsCh)
+	return q.db.Close()
+}
+
+// loadFromDisk reads persisted jobs into memory and returns the ones left
+// `queued` by a prior run so they can be resumed. Jobs caught mid-`running`
+// when the process died are marked failed: we can't trust a deploy that
+// never reported completion. A queued job that needed a secret (a token or
+// signed URL, none of which bbolt ever stores) is failed the same way
+// rather than resumed: resuming it would call the handler with that field
+// silently empty instead of actually retrying the deploy.
+func (q *Queue) loadFromDisk() ([]*Job, error) {
+	var resumable []*Job
+
+	err := q.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(jobsBucket))
+		return b.ForEach(func(k, v []byte) error {
+			var job Job
+			if err := json.Unmarshal(v, &job); err != nil {
+				return fmt.Errorf("decoding job %s: %w", k, err)
+			}
+
+			switch {
+			case job.Status == StatusQueued && job.NeedsSecret:
+				if err := failInPlace(b, k, &job, "cannot resume after restart: job needs a secret (token or signed URL) that is deliberately not persisted"); err != nil {
+					return err
+				}
+			case job.Status == StatusQueued:
+				resumable = append(resumable, &job)
+			case job.Status == StatusRunning:
+				if err := failInPlace(b, k, &job, "interrupted by restart"); err != nil {
+					return err
+				}
+			}
+
+			q.publish(&job)
+			return nil
+		})
+	})
+	return resumable, err
+}
+
+// failInPlace marks job Failed with msg, stamps FinishedAt, and rewrites it
+// under k in bucket b.
+func failInPlace(b *bolt.Bucket, k []byte, job *Job, msg string) error {
+	job.Status = StatusFailed
+	job.Error = msg
+	now := time.Now()
+	job.FinishedAt = &now
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return b.Put(k, encoded)
+}
+
+// Enqueue submits req as a new job (its ID/Status/CreatedAt are set here and
+// need not be populated by the caller). If an equivalent job (same artifact
+// and signature) was submitted within idempotencyTTL, the existing job is
+// returned instead of starting a new deploy.
+func (q *Queue) Enqueue(req Job) (*Job, bool, error) {
+	// ArtifactID/Signature alone aren't unique across sources: the https
+	// source often leaves ArtifactID empty and relies on URL instead, and a
+	// GitHub and GitLab job could otherwise share the same ArtifactID value.
+	// So fold in the job's key, source, and URL too.
+	idemKey := req.key() + "|" + req.Source + "|" + req.ArtifactID + "|" + req.URL + "|" + req.Signature
+
+	if existing, err := q.lookupIdempotent(idemKey); err != nil {
+		return nil, false, err
+	} else if existing != nil {
+		return existing, true, nil
+	}
+
+	job := req
+	job.ID = newJobID()
+	job.Status = StatusQueued
+	job.CreatedAt = time.Now()
+	job.NeedsSecret = job.GitHubToken != "" || job.GitLabToken != "" || job.URL != ""
+
+	if err := q.persist(&job); err != nil {
+		return nil, false, err
+	}
+	if err := q.recordIdempotent(idemKey, job.ID); err != nil {
+		return nil, false, err
+	}
+
+	q.publish(&job)
+
+	q.jobsCh <- &job
+	return &job, false, nil
+}
+
+// Get returns a job by ID.
+func (q *Queue) Get(id string) (*Job, bool) {
+	q.jobsMu.RLock()
+	defer q.jobsMu.RUnlock()
+	job, ok := q.jobs[id]
+	return job, ok
+}
+
+// List returns jobs for project in creation order, or all jobs if project
+// is empty.
+func (q *Queue) List(project string) []*Job {
+	q.jobsMu.RLock()
+	defer q.jobsMu.RUnlock()
+
+	var out []*Job
+	for _, job := range q.jobs {
+		if project == "" || job.Project == project {
+			out = append(out, job)
+		}
+	}
+	sortByCreatedAt(out)
+	return out
+}
+
+func sortByCreatedAt(jobs []*Job) {
+	for i := 1; i < len(jobs); i++ {
+		for j := i; j > 0 && jobs[j].CreatedAt.Before(jobs[j-1].CreatedAt); j-- {
+			jobs[j], jobs[j-1] = jobs[j-1], jobs[j]
+		}
+	}
+}
+
+func (q *Queue) worker() {
+	for job := range q.jobsCh {
+		q.run(job)
+	}
+}
+
+// run executes a single job, holding the per-(area,project) lock for its
+// duration so at most one deploy per project runs concurrently.
+//
+// It never mutates the *Job already published in q.jobs: Get/List hand that
+// pointer straight to json.Marshal under only jobsMu.RLock, which guards the
+// map, not the struct it points to. Instead each status transition builds a
+// fresh copy and swaps it into the map under jobsMu, so a concurrent reader
+// always sees a complete, untouched-after-publish Job.
+func (q *Queue) run(job *Job) {
+	lock := q.projectLock(job.key())
+	lock.Lock()
+	defer lock.Unlock()
+
+	now := time.Now()
+	running := *job
+	running.Status = StatusRunning
+	running.StartedAt = &now
+	q.publish(&running)
+	q.persist(&running)
+
+	generation, err := q.handler(&running)
+
+	done := running
+	finished := time.Now()
+	done.FinishedAt = &finished
+	if err != nil {
+		done.Status = StatusFailed
+		done.Error = err.Error()
+	} else {
+		done.Status = StatusSucceeded
+		done.Generation = generation
+	}
+	q.publish(&done)
+	q.persist(&done)
+}
+
+// publish replaces q.jobs[job.ID] with job. Callers must treat job as
+// immutable from this point on; further updates publish a new copy instead
+// of mutating this one in place.
+func (q *Queue) publish(job *Job) {
+	q.jobsMu.Lock()
+	q.jobs[job.ID] = job
+	q.jobsMu.Unlock()
+}
+
+// WithProjectLock runs fn while holding the same per-(area,project) lock
+// run() takes for a queued deploy, so a caller that mutates a project's
+// release directory outside the queue (e.g. a manual rollback) can't
+// interleave with an in-flight deploy for that project.
+func (q *Queue) WithProjectLock(area, project string, fn func() error) error {
+	lock := q.projectLock(projectKey(area, project))
+	lock.Lock()
+	defer lock.Unlock()
+	return fn()
+}
+
+func (q *Queue) projectLock(key string) *sync.Mutex {
+	q.projectLocksMu.Lock()
+	defer q.projectLocksMu.Unlock()
+
+	lock, ok := q.projectLocks[key]
+	if !ok {
+		lock = &sync.Mutex{}
+		q.projectLocks[key] = lock
+	}
+	return lock
+}
+
+func (q *Queue) persist(job *Job) error {
+	encoded, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(jobsBucket)).Put([]byte(job.ID), encoded)
+	})
+}
+
+type idempotencyEntry struct {
+	JobID     string    `json:"job_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func (q *Queue) lookupIdempotent(key string) (*Job, error) {
+	var entry *idempotencyEntry
+
+	err := q.db.View(func(tx *bolt.Tx) error {
+		raw := tx.Bucket([]byte(idempotencyBucket)).Get([]byte(key))
+		if raw == nil {
+			return nil
+		}
+		var e idempotencyEntry
+		if err := json.Unmarshal(raw, &e); err != nil {
+			return err
+		}
+		entry = &e
+		return nil
+	})
+	if err != nil || entry == nil || time.Now().After(entry.ExpiresAt) {
+		return nil, err
+	}
+
+	job, ok := q.Get(entry.JobID)
+	if !ok {
+		return nil, nil
+	}
+	return job, nil
+}
+
+func (q *Queue) recordIdempotent(key, jobID string) error {
+	entry := idempotencyEntry{JobID: jobID, ExpiresAt: time.Now().Add(idempotencyTTL)}
+	encoded, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	return q.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket([]byte(idempotencyBucket)).Put([]byte(key), encoded)
+	})
+}
+
+func newJobID() string {
+	return fmt.Sprintf("job-%d", time.Now().UnixNano())
+}
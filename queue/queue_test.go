@@ -0,0 +1,125 @@
+package queue
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// TestConcurrentEnqueueListRun exercises Enqueue, List, and the worker pool's
+// run() from many goroutines at once. Run with -race: run() used to mutate
+// the *Job already published in q.jobs directly, which raced against List's
+// json-less read of that same pointer under only jobsMu.RLock.
+func TestConcurrentEnqueueListRun(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "queue.db")
+
+	var handled sync.WaitGroup
+	q, err := Open(dbPath, 4, func(job *Job) (string, error) {
+		defer handled.Done()
+		time.Sleep(time.Millisecond)
+		return "gen-" + job.ArtifactID, nil
+	})
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer q.Close()
+
+	const jobCount = 50
+	handled.Add(jobCount)
+
+	var wg sync.WaitGroup
+	for i := 0; i < jobCount; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, _, err := q.Enqueue(Job{
+				Area:       "area",
+				Project:    "project",
+				ArtifactID: string(rune('a' + i%26)),
+				Signature:  string(rune('0' + i)),
+			})
+			if err != nil {
+				t.Errorf("Enqueue() failed: %v", err)
+			}
+		}(i)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			q.List("project")
+		}()
+	}
+	wg.Wait()
+	handled.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		for {
+			all := q.List("project")
+			pending := 0
+			for _, job := range all {
+				if job.Status == StatusQueued || job.Status == StatusRunning {
+					pending++
+				}
+			}
+			if pending == 0 {
+				close(done)
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for jobs to finish")
+	}
+
+	for _, job := range q.List("project") {
+		if job.Status != StatusSucceeded {
+			t.Errorf("job %s ended with status %s, want %s", job.ID, job.Status, StatusSucceeded)
+		}
+	}
+}
+
+// TestEnqueueIdempotent checks that a repeated submission of the same
+// artifact+signature returns the existing job instead of enqueuing a new one.
+func TestEnqueueIdempotent(t *testing.T) {
+	dbPath := filepath.Join(t.TempDir(), "queue.db")
+
+	block := make(chan struct{})
+	q, err := Open(dbPath, 1, func(job *Job) (string, error) {
+		<-block
+		return "gen", nil
+	})
+	if err != nil {
+		t.Fatalf("Open() failed: %v", err)
+	}
+	defer func() {
+		close(block)
+		q.Close()
+	}()
+
+	req := Job{Area: "area", Project: "project", ArtifactID: "sha123", Signature: "sig123"}
+
+	first, existed, err := q.Enqueue(req)
+	if err != nil {
+		t.Fatalf("first Enqueue() failed: %v", err)
+	}
+	if existed {
+		t.Fatal("first Enqueue() reported existed=true")
+	}
+
+	second, existed, err := q.Enqueue(req)
+	if err != nil {
+		t.Fatalf("second Enqueue() failed: %v", err)
+	}
+	if !existed {
+		t.Fatal("second Enqueue() of the same artifact+signature reported existed=false")
+	}
+	if second.ID != first.ID {
+		t.Fatalf("second Enqueue() returned job %s, want %s", second.ID, first.ID)
+	}
+}
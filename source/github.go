@@ -0,0 +1,100 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/walker84837/vps-deploy-service/ghapp"
+)
+
+// GitHubSource fetches GitHub Actions workflow artifacts, authenticating
+// with a per-request PAT or, if none is given, a configured GitHub App
+// installation token.
+type GitHubSource struct {
+	// App mints installation tokens when no per-request token is given.
+	// Nil disables that fallback.
+	App *ghapp.TokenSource
+}
+
+// Name implements Source.
+func (g *GitHubSource) Name() string { return "github" }
+
+// Token resolves the token to authenticate with: token itself if set,
+// otherwise a freshly minted GitHub App installation token.
+func (g *GitHubSource) Token(token string) (string, error) {
+	if token != "" {
+		return token, nil
+	}
+	if g.App != nil {
+		return g.App.Token()
+	}
+	return "", errors.New("missing GitHub token")
+}
+
+// Fetch downloads a GitHub Actions artifact as a ZIP to a temp file.
+func (g *GitHubSource) Fetch(req Request) (string, error) {
+	if req.Owner == "" || req.Repo == "" {
+		return "", errors.New("missing owner or repo")
+	}
+	token, err := g.Token(req.GitHubToken)
+	if err != nil {
+		return "", err
+	}
+
+	url := fmt.Sprintf(
+		"https://api.github.com/repos/%s/%s/actions/artifacts/%s/zip",
+		req.Owner, req.Repo, req.ArtifactID,
+	)
+
+	httpReq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("creating request failed: %w", err)
+	}
+	httpReq.Header.Set("Authorization", "Bearer "+token)
+	httpReq.Header.Set("Accept", "application/vnd.github+json")
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return nil // allow following the redirect to the actual zip URL
+		},
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusFound {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to download artifact: %s\n%s", resp.Status, string(bodyBytes))
+	}
+
+	if resp.StatusCode == http.StatusFound {
+		redirectURL := resp.Header.Get("Location")
+		if redirectURL == "" {
+			return "", errors.New("artifact redirect location missing")
+		}
+		resp, err = http.Get(redirectURL)
+		if err != nil {
+			return "", fmt.Errorf("failed to download redirected artifact: %w", err)
+		}
+		defer resp.Body.Close()
+	}
+
+	dest := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%s.zip", req.Project, req.ArtifactID))
+	outFile, err := os.Create(dest)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer outFile.Close()
+
+	if _, err := io.Copy(outFile, resp.Body); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return dest, nil
+}
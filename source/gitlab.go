@@ -0,0 +1,65 @@
+package source
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+const defaultGitLabBaseURL = "https://gitlab.com"
+
+// GitLabSource fetches GitLab CI job artifacts.
+type GitLabSource struct{}
+
+// Name implements Source.
+func (g *GitLabSource) Name() string { return "gitlab" }
+
+// Fetch downloads a GitLab CI job's artifacts archive to a temp file.
+func (g *GitLabSource) Fetch(req Request) (string, error) {
+	if req.GitLabProjectID == "" || req.GitLabJobID == "" {
+		return "", errors.New("missing gitlab project id or job id")
+	}
+	if req.GitLabToken == "" {
+		return "", errors.New("missing gitlab token")
+	}
+
+	baseURL := req.GitLabBaseURL
+	if baseURL == "" {
+		baseURL = defaultGitLabBaseURL
+	}
+
+	url := fmt.Sprintf("%s/api/v4/projects/%s/jobs/%s/artifacts", baseURL, req.GitLabProjectID, req.GitLabJobID)
+
+	httpReq, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return "", fmt.Errorf("creating request failed: %w", err)
+	}
+	httpReq.Header.Set("PRIVATE-TOKEN", req.GitLabToken)
+
+	resp, err := http.DefaultClient.Do(httpReq)
+	if err != nil {
+		return "", fmt.Errorf("http request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("failed to download artifact: %s\n%s", resp.Status, string(bodyBytes))
+	}
+
+	dest := filepath.Join(os.TempDir(), fmt.Sprintf("%s-%s.zip", req.Project, req.GitLabJobID))
+	outFile, err := os.Create(dest)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file: %w", err)
+	}
+	defer outFile.Close()
+
+	if _, err := io.Copy(outFile, resp.Body); err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+
+	return dest, nil
+}
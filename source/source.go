@@ -0,0 +1,63 @@
+// Package source abstracts where a deploy artifact comes from, so the
+// daemon can pull from GitHub Actions, GitLab CI, or a generic signed HTTPS
+// URL through the same deploy pipeline.
+package source
+
+import (
+	"fmt"
+)
+
+// Request carries whichever fields the selected Source needs to locate and
+// authenticate an artifact fetch. Unused fields are ignored by a given
+// Source implementation.
+type Request struct {
+	Project string
+
+	// GitHub Actions
+	Owner       string
+	Repo        string
+	ArtifactID  string
+	GitHubToken string
+
+	// GitLab CI
+	GitLabBaseURL   string
+	GitLabProjectID string
+	GitLabJobID     string
+	GitLabToken     string
+
+	// Generic signed HTTPS URL
+	URL string
+}
+
+// Source fetches an artifact to a local temp file and returns its path.
+// Callers are responsible for removing the file once done with it.
+type Source interface {
+	// Name is the discriminator value used in WebhookPayload.Source and in
+	// an AreaConfig's AllowedSources.
+	Name() string
+	Fetch(req Request) (string, error)
+}
+
+// Registry resolves a Source by its discriminator name.
+type Registry struct {
+	sources map[string]Source
+}
+
+// NewRegistry builds a Registry from the given sources, keyed by their
+// Name().
+func NewRegistry(sources ...Source) *Registry {
+	r := &Registry{sources: make(map[string]Source, len(sources))}
+	for _, s := range sources {
+		r.sources[s.Name()] = s
+	}
+	return r
+}
+
+// Get returns the Source registered under name.
+func (r *Registry) Get(name string) (Source, error) {
+	s, ok := r.sources[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown artifact source: %s", name)
+	}
+	return s, nil
+}